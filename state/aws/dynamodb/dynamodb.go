@@ -0,0 +1,806 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package dynamodb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+const (
+	defaultTTLAttributeName = "expiresAt"
+	metadataTTLKey          = "ttlInSeconds"
+	etagAttributeName       = "etag"
+	etagConditionExpression = "attribute_not_exists(" + etagAttributeName + ") OR " + etagAttributeName + " = :etag"
+
+	// maxTransactionalOperations is the number of items AWS allows in a
+	// single TransactWriteItems (or BatchWriteItem) call.
+	maxTransactionalOperations = 25
+
+	// endpointEnvVar is checked when the `Endpoint` metadata property is
+	// absent, letting a conformance/CI run point every component instance at
+	// DynamoDB Local or LocalStack without editing component YAML.
+	endpointEnvVar = "DYNAMODB_LOCAL"
+
+	// daxProbeTimeout bounds the one-time reachability check getClient runs
+	// against a freshly constructed DAX client before trusting it.
+	daxProbeTimeout = 2 * time.Second
+)
+
+// dynamoDBClient is the subset of the DynamoDB API surface the state store
+// needs. Both *dynamodb.DynamoDB and *dax.Dax (used when DAX acceleration is
+// enabled) already implement it with the same method set, so the store can
+// swap clients without any adapter.
+type dynamoDBClient interface {
+	GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error)
+	PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error)
+	DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error)
+	BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error)
+	QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error)
+	ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error)
+}
+
+// StateStore is a DynamoDB state store.
+type StateStore struct {
+	client dynamoDBClient
+	table  string
+
+	ttlAttributeName string
+	enableTTL        bool
+
+	indexes []queryIndex
+}
+
+// NewDynamoDBStateStore returns a new DynamoDB state store.
+func NewDynamoDBStateStore() *StateStore {
+	return &StateStore{}
+}
+
+// Init does metadata and connection parsing.
+func (d *StateStore) Init(metadata state.Metadata) error {
+	accessKey := metadata.Properties["AccessKey"]
+	secretKey := metadata.Properties["SecretKey"]
+	sessionToken := metadata.Properties["SessionToken"]
+	region := metadata.Properties["Region"]
+	table := metadata.Properties["Table"]
+
+	if len(accessKey) == 0 || len(secretKey) == 0 || len(region) == 0 {
+		return fmt.Errorf("missing aws credentials in metadata")
+	}
+
+	endpoint := metadata.Properties["Endpoint"]
+	if endpoint == "" {
+		endpoint = os.Getenv(endpointEnvVar)
+	}
+
+	cfg := &aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials(accessKey, secretKey, sessionToken),
+	}
+	if endpoint != "" {
+		cfg.Endpoint = aws.String(endpoint)
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return err
+	}
+
+	d.table = table
+
+	d.ttlAttributeName = metadata.Properties["ttlAttributeName"]
+	if d.ttlAttributeName == "" {
+		d.ttlAttributeName = defaultTTLAttributeName
+	}
+	d.enableTTL = metadata.Properties["enableTTL"] == "true"
+
+	indexes, err := parseQueryIndexes(metadata.Properties["queryIndexes"])
+	if err != nil {
+		return err
+	}
+	d.indexes = indexes
+
+	if err := d.ensureTableExists(sess, metadata); err != nil {
+		return err
+	}
+
+	if err := d.enableTableTTL(sess); err != nil {
+		return err
+	}
+
+	d.client = d.getClient(sess, metadata)
+
+	return nil
+}
+
+// getClient returns a DAX-accelerated client when useDAX is requested and a
+// cluster is reachable, falling back to talking to DynamoDB directly
+// otherwise - a latency-sensitive cache should never be a hard dependency.
+// dax.New only validates the cluster config locally; it doesn't dial the
+// cluster, so a syntactically valid but unreachable endpoint is probed with
+// a cheap read before the DAX client is trusted.
+func (d *StateStore) getClient(sess *session.Session, metadata state.Metadata) dynamoDBClient {
+	if metadata.Properties["useDAX"] != "true" {
+		return dynamodb.New(sess)
+	}
+
+	endpoints := strings.Split(metadata.Properties["daxEndpoints"], ",")
+
+	cfg := dax.DefaultConfig()
+	cfg.HostPorts = endpoints
+	cfg.Region = *sess.Config.Region
+	cfg.Credentials = sess.Config.Credentials
+
+	daxClient, err := dax.New(cfg)
+	if err != nil || !d.daxReachable(daxClient) {
+		return dynamodb.New(sess)
+	}
+
+	return daxClient
+}
+
+// daxReachable probes a DAX client with a cheap read so an unreachable
+// cluster falls back to plain DynamoDB instead of failing every subsequent
+// Get/Set/Delete call.
+func (d *StateStore) daxReachable(client dynamoDBClient) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), daxProbeTimeout)
+	defer cancel()
+
+	_, err := client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String("dapr-dax-health-check")},
+		},
+	})
+
+	return err == nil
+}
+
+// ensureTableExists creates the component's table on first use when
+// `createTableIfNotExists` is set, so a conformance/CI run can point at a
+// throwaway DynamoDB Local instance without any out-of-band provisioning.
+// Table management is a control-plane operation DAX doesn't proxy, so this
+// always talks to DynamoDB directly rather than through d.client.
+func (d *StateStore) ensureTableExists(sess *session.Session, metadata state.Metadata) error {
+	if metadata.Properties["createTableIfNotExists"] != "true" {
+		return nil
+	}
+
+	client := dynamodb.New(sess)
+
+	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(d.table)})
+	if err == nil {
+		return nil
+	}
+
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != dynamodb.ErrCodeResourceNotFoundException {
+		return err
+	}
+
+	attributeDefinitions := map[string]*dynamodb.AttributeDefinition{
+		"key": {AttributeName: aws.String("key"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+	}
+
+	input := &dynamodb.CreateTableInput{
+		TableName: aws.String(d.table),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("key"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		},
+	}
+
+	rcu, wcu, provisioned := readWriteCapacity(metadata)
+	if provisioned {
+		input.BillingMode = aws.String(dynamodb.BillingModeProvisioned)
+		input.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(rcu),
+			WriteCapacityUnits: aws.Int64(wcu),
+		}
+	} else {
+		input.BillingMode = aws.String(dynamodb.BillingModePayPerRequest)
+	}
+
+	// Every declared GSI (see queryIndexes in query.go) must exist on the
+	// table up front, or Query() will send an IndexName that DynamoDB
+	// rejects at request time.
+	for _, idx := range d.indexes {
+		attributeDefinitions[idx.PartitionKey] = &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(idx.PartitionKey),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		}
+
+		keySchema := []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(idx.PartitionKey), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		}
+		if idx.SortKey != "" {
+			attributeDefinitions[idx.SortKey] = &dynamodb.AttributeDefinition{
+				AttributeName: aws.String(idx.SortKey),
+				AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+			}
+			keySchema = append(keySchema, &dynamodb.KeySchemaElement{
+				AttributeName: aws.String(idx.SortKey), KeyType: aws.String(dynamodb.KeyTypeRange),
+			})
+		}
+
+		gsi := &dynamodb.GlobalSecondaryIndex{
+			IndexName: aws.String(idx.Name),
+			KeySchema: keySchema,
+			Projection: &dynamodb.Projection{
+				ProjectionType: aws.String(dynamodb.ProjectionTypeAll),
+			},
+		}
+		if provisioned {
+			gsi.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64(rcu),
+				WriteCapacityUnits: aws.Int64(wcu),
+			}
+		}
+
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, gsi)
+	}
+
+	for _, def := range attributeDefinitions {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, def)
+	}
+
+	if _, err := client.CreateTable(input); err != nil {
+		return err
+	}
+
+	return client.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(d.table)})
+}
+
+// enableTableTTL turns on DynamoDB's native TTL feature for d.ttlAttributeName
+// when enableTTL is set, so items stamped with an expiry by getItemFromReq
+// are actually deleted by DynamoDB instead of merely hidden from reads by
+// isExpired. Like ensureTableExists, this is a control-plane call DAX
+// doesn't proxy, so it always talks to DynamoDB directly. It's safe to call
+// on every Init: AWS rejects a repeat call for an attribute that's already
+// enabled, and that's treated as success.
+func (d *StateStore) enableTableTTL(sess *session.Session) error {
+	if !d.enableTTL {
+		return nil
+	}
+
+	client := dynamodb.New(sess)
+
+	_, err := client.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(d.table),
+		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+			AttributeName: aws.String(d.ttlAttributeName),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err == nil {
+		return nil
+	}
+
+	// AWS has no modeled ErrCode constant for this: re-enabling TTL on the
+	// same attribute is rejected with a plain "ValidationException", which
+	// we treat as already-done rather than a failure.
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ValidationException" {
+		return nil
+	}
+
+	return err
+}
+
+// readWriteCapacity parses the optional `readCapacityUnits`/
+// `writeCapacityUnits` metadata pair. Either both are set, selecting
+// provisioned billing, or neither is, leaving the table on-demand.
+func readWriteCapacity(metadata state.Metadata) (rcu, wcu int64, ok bool) {
+	rawRead := metadata.Properties["readCapacityUnits"]
+	rawWrite := metadata.Properties["writeCapacityUnits"]
+	if rawRead == "" || rawWrite == "" {
+		return 0, 0, false
+	}
+
+	rcu, err := strconv.ParseInt(rawRead, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	wcu, err = strconv.ParseInt(rawWrite, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return rcu, wcu, true
+}
+
+// Get retrieves a dynamoDB item.
+func (d *StateStore) Get(ctx context.Context, req *state.GetRequest) (*state.GetResponse, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {
+				S: aws.String(req.Key),
+			},
+		},
+		ConsistentRead: aws.Bool(req.Options.Consistency == state.Strong),
+	}
+
+	result, err := d.client.GetItemWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Item) == 0 {
+		return &state.GetResponse{}, nil
+	}
+
+	if d.isExpired(result.Item) {
+		return &state.GetResponse{}, nil
+	}
+
+	var output string
+	if attr, ok := result.Item["value"]; ok && attr.S != nil {
+		output = *attr.S
+	}
+
+	var etag string
+	if attr, ok := result.Item[etagAttributeName]; ok && attr.S != nil {
+		etag = *attr.S
+	}
+
+	return &state.GetResponse{
+		Data: []byte(output),
+		ETag: etag,
+	}, nil
+}
+
+// Set saves a dynamoDB item, honoring the request's ETag as an optimistic
+// concurrency check when one is supplied.
+func (d *StateStore) Set(ctx context.Context, req *state.SetRequest) error {
+	item, err := d.getItemFromReq(req)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      item,
+	}
+	if req.ETag != "" {
+		input.ConditionExpression = aws.String(etagConditionExpression)
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":etag": {S: aws.String(req.ETag)},
+		}
+	}
+
+	_, err = d.client.PutItemWithContext(ctx, input)
+
+	return translateETagErr(err)
+}
+
+// BulkSet performs a bulk save operation. If any request carries an ETag,
+// the whole batch is written through TransactWriteItems so every condition
+// check is honored atomically; BatchWriteItem cannot express conditions.
+// Like Multi, a batch over the AWS per-call item limit is rejected outright
+// rather than chunked, since chunking either call would mean a later chunk
+// could fail after an earlier one already wrote.
+func (d *StateStore) BulkSet(ctx context.Context, req []state.SetRequest) error {
+	if len(req) > maxTransactionalOperations {
+		return fmt.Errorf("dynamodb error: bulk set has %d items, which exceeds the %d-item limit of a single BatchWriteItem/TransactWriteItems call", len(req), maxTransactionalOperations)
+	}
+
+	for i := range req {
+		if req[i].ETag != "" {
+			return d.transactSet(ctx, req)
+		}
+	}
+
+	writeRequests := make([]*dynamodb.WriteRequest, 0, len(req))
+
+	for i := range req {
+		item, err := d.getItemFromReq(&req[i])
+		if err != nil {
+			return err
+		}
+
+		writeRequests = append(writeRequests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: item,
+			},
+		})
+	}
+
+	input := &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{
+			d.table: writeRequests,
+		},
+	}
+
+	_, err := d.client.BatchWriteItemWithContext(ctx, input)
+
+	return err
+}
+
+// transactSet writes a batch of sets as a single TransactWriteItems call so
+// that per-item ETag condition checks are evaluated atomically.
+func (d *StateStore) transactSet(ctx context.Context, req []state.SetRequest) error {
+	items := make([]*dynamodb.TransactWriteItem, 0, len(req))
+
+	for i := range req {
+		item, err := d.getItemFromReq(&req[i])
+		if err != nil {
+			return err
+		}
+
+		put := &dynamodb.Put{
+			TableName: aws.String(d.table),
+			Item:      item,
+		}
+		if req[i].ETag != "" {
+			put.ConditionExpression = aws.String(etagConditionExpression)
+			put.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+				":etag": {S: aws.String(req[i].ETag)},
+			}
+		}
+
+		items = append(items, &dynamodb.TransactWriteItem{Put: put})
+	}
+
+	_, err := d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+
+	return translateETagErr(err)
+}
+
+// Delete performs a delete operation, honoring the request's ETag as an
+// optimistic concurrency check when one is supplied.
+func (d *StateStore) Delete(ctx context.Context, req *state.DeleteRequest) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {
+				S: aws.String(req.Key),
+			},
+		},
+	}
+	if req.ETag != "" {
+		input.ConditionExpression = aws.String(etagConditionExpression)
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":etag": {S: aws.String(req.ETag)},
+		}
+	}
+
+	_, err := d.client.DeleteItemWithContext(ctx, input)
+
+	return translateETagErr(err)
+}
+
+// BulkDelete performs a bulk delete operation. If any request carries an
+// ETag, the whole batch is written through TransactWriteItems so every
+// condition check is honored atomically, mirroring BulkSet. Like BulkSet, a
+// batch over the AWS per-call item limit is rejected outright rather than
+// chunked.
+func (d *StateStore) BulkDelete(ctx context.Context, req []state.DeleteRequest) error {
+	if len(req) > maxTransactionalOperations {
+		return fmt.Errorf("dynamodb error: bulk delete has %d items, which exceeds the %d-item limit of a single BatchWriteItem/TransactWriteItems call", len(req), maxTransactionalOperations)
+	}
+
+	for i := range req {
+		if req[i].ETag != "" {
+			return d.transactDelete(ctx, req)
+		}
+	}
+
+	writeRequests := make([]*dynamodb.WriteRequest, 0, len(req))
+
+	for _, r := range req {
+		writeRequests = append(writeRequests, &dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{
+				Key: map[string]*dynamodb.AttributeValue{
+					"key": {
+						S: aws.String(r.Key),
+					},
+				},
+			},
+		})
+	}
+
+	input := &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{
+			d.table: writeRequests,
+		},
+	}
+
+	_, err := d.client.BatchWriteItemWithContext(ctx, input)
+
+	return err
+}
+
+// transactDelete deletes a batch as a single TransactWriteItems call so
+// that per-item ETag condition checks are evaluated atomically.
+func (d *StateStore) transactDelete(ctx context.Context, req []state.DeleteRequest) error {
+	items := make([]*dynamodb.TransactWriteItem, 0, len(req))
+
+	for i := range req {
+		del := &dynamodb.Delete{
+			TableName: aws.String(d.table),
+			Key: map[string]*dynamodb.AttributeValue{
+				"key": {
+					S: aws.String(req[i].Key),
+				},
+			},
+		}
+		if req[i].ETag != "" {
+			del.ConditionExpression = aws.String(etagConditionExpression)
+			del.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+				":etag": {S: aws.String(req[i].ETag)},
+			}
+		}
+
+		items = append(items, &dynamodb.TransactWriteItem{Delete: del})
+	}
+
+	_, err := d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+
+	return translateETagErr(err)
+}
+
+// Multi implements state.TransactionalStore by mapping the whole batch to a
+// single TransactWriteItems call, so every operation either commits or is
+// cancelled together. AWS caps a TransactWriteItems call at
+// maxTransactionalOperations items; since splitting a larger batch into
+// multiple calls would mean a later chunk could fail after an earlier one
+// already committed - silently breaking the atomicity callers expect from
+// this interface - a batch over that limit is rejected outright instead.
+func (d *StateStore) Multi(ctx context.Context, operations []state.TransactionalOperation) error {
+	if len(operations) > maxTransactionalOperations {
+		return fmt.Errorf("dynamodb error: transaction has %d operations, which exceeds the %d-item limit of a single TransactWriteItems call", len(operations), maxTransactionalOperations)
+	}
+
+	return d.transactWrite(ctx, operations)
+}
+
+// transactWrite issues a single TransactWriteItems call for the whole batch
+// of operations, which Multi has already checked against the AWS limit.
+func (d *StateStore) transactWrite(ctx context.Context, operations []state.TransactionalOperation) error {
+	items := make([]*dynamodb.TransactWriteItem, 0, len(operations))
+	keys := make([]string, 0, len(operations))
+
+	for _, op := range operations {
+		switch op.Operation {
+		case state.Upsert:
+			setReq, ok := op.Request.(state.SetRequest)
+			if !ok {
+				return fmt.Errorf("dynamodb error: expected state.SetRequest for upsert operation, got %T", op.Request)
+			}
+
+			item, err := d.getItemFromReq(&setReq)
+			if err != nil {
+				return err
+			}
+
+			put := &dynamodb.Put{
+				TableName: aws.String(d.table),
+				Item:      item,
+			}
+			if setReq.ETag != "" {
+				put.ConditionExpression = aws.String(etagConditionExpression)
+				put.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+					":etag": {S: aws.String(setReq.ETag)},
+				}
+			}
+
+			items = append(items, &dynamodb.TransactWriteItem{Put: put})
+			keys = append(keys, setReq.Key)
+		case state.Delete:
+			delReq, ok := op.Request.(state.DeleteRequest)
+			if !ok {
+				return fmt.Errorf("dynamodb error: expected state.DeleteRequest for delete operation, got %T", op.Request)
+			}
+
+			del := &dynamodb.Delete{
+				TableName: aws.String(d.table),
+				Key: map[string]*dynamodb.AttributeValue{
+					"key": {
+						S: aws.String(delReq.Key),
+					},
+				},
+			}
+			if delReq.ETag != "" {
+				del.ConditionExpression = aws.String(etagConditionExpression)
+				del.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+					":etag": {S: aws.String(delReq.ETag)},
+				}
+			}
+
+			items = append(items, &dynamodb.TransactWriteItem{Delete: del})
+			keys = append(keys, delReq.Key)
+		default:
+			return fmt.Errorf("dynamodb error: unsupported operation type %s", op.Operation)
+		}
+	}
+
+	_, err := d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		return translateTransactionErr(err, keys)
+	}
+
+	return nil
+}
+
+// TransactionCancelledError reports which keys in a cancelled
+// TransactWriteItems call failed, and why, so callers can react per-item
+// instead of treating the whole transaction as an opaque failure.
+type TransactionCancelledError struct {
+	Reasons []TransactionCancellationReason
+}
+
+// TransactionCancellationReason is the per-item cancellation reason AWS
+// returns alongside a TransactionCanceledException.
+type TransactionCancellationReason struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (e *TransactionCancelledError) Error() string {
+	return fmt.Sprintf("dynamodb error: transaction cancelled, %d item(s) failed", len(e.Reasons))
+}
+
+// translateTransactionErr converts an AWS TransactionCanceledException into
+// a TransactionCancelledError keyed by the item that failed, falling back to
+// the original error for anything else (e.g. throttling, network errors).
+func translateTransactionErr(err error, keys []string) error {
+	var canceled *dynamodb.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return err
+	}
+
+	cancelErr := &TransactionCancelledError{}
+
+	for i, reason := range canceled.CancellationReasons {
+		if reason.Code == nil || *reason.Code == "None" {
+			continue
+		}
+
+		var key, message string
+		if i < len(keys) {
+			key = keys[i]
+		}
+		if reason.Message != nil {
+			message = *reason.Message
+		}
+
+		cancelErr.Reasons = append(cancelErr.Reasons, TransactionCancellationReason{
+			Key:     key,
+			Code:    *reason.Code,
+			Message: message,
+		})
+	}
+
+	return cancelErr
+}
+
+// getItemFromReq builds the DynamoDB attribute map for a set request,
+// stamping in a TTL attribute when TTL is enabled on the store and the
+// request's metadata sets ttlInSeconds.
+func (d *StateStore) getItemFromReq(req *state.SetRequest) (map[string]*dynamodb.AttributeValue, error) {
+	value, err := d.marshalToString(req.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	item := map[string]*dynamodb.AttributeValue{
+		"key": {
+			S: aws.String(req.Key),
+		},
+		"value": {
+			S: aws.String(value),
+		},
+		etagAttributeName: {
+			S: aws.String(uuid.New().String()),
+		},
+	}
+
+	if ttl, ok, err := d.ttlExpiresAt(req); err != nil {
+		return nil, err
+	} else if ok {
+		item[d.ttlAttributeName] = &dynamodb.AttributeValue{
+			N: aws.String(fmt.Sprintf("%d", ttl)),
+		}
+	}
+
+	return item, nil
+}
+
+// ttlExpiresAt returns the Unix epoch at which the item should expire, based
+// on the ttlInSeconds value in the request metadata, if the store has TTL
+// support enabled.
+func (d *StateStore) ttlExpiresAt(req *state.SetRequest) (int64, bool, error) {
+	if !d.enableTTL {
+		return 0, false, nil
+	}
+
+	ttlString, ok := req.Metadata[metadataTTLKey]
+	if !ok || ttlString == "" {
+		return 0, false, nil
+	}
+
+	var ttlInSeconds int64
+	if _, err := fmt.Sscanf(ttlString, "%d", &ttlInSeconds); err != nil {
+		return 0, false, fmt.Errorf("dynamodb error: failed to parse ttlInSeconds: %s", err)
+	}
+
+	return time.Now().Unix() + ttlInSeconds, true, nil
+}
+
+// isExpired returns true when the item carries a TTL attribute whose value
+// is already in the past. DynamoDB only guarantees eventual deletion of
+// expired items, so callers must not rely solely on its native TTL sweep.
+func (d *StateStore) isExpired(item map[string]*dynamodb.AttributeValue) bool {
+	attr, ok := item[d.ttlAttributeName]
+	if !ok || attr.N == nil {
+		return false
+	}
+
+	var expiresAt int64
+	if _, err := fmt.Sscanf(*attr.N, "%d", &expiresAt); err != nil {
+		return false
+	}
+
+	return time.Now().Unix() >= expiresAt
+}
+
+// translateETagErr converts a DynamoDB conditional-check failure, as raised
+// by an ETag mismatch, into a state.ETagError the Dapr runtime can
+// distinguish from a generic failure.
+func translateETagErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return state.NewETagError(state.ETagMismatch, err)
+	}
+
+	return err
+}
+
+func (d *StateStore) marshalToString(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case []byte:
+		return string(value), nil
+	case string:
+		return value, nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+
+		return string(b), nil
+	}
+}
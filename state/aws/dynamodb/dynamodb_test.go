@@ -5,40 +5,58 @@
 package dynamodb
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/dapr/components-contrib/state"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockedDynamoDB struct {
-	GetItemFn        func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
-	PutItemFn        func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
-	DeleteItemFn     func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
-	BatchWriteItemFn func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
-	dynamodbiface.DynamoDBAPI
+	GetItemFn            func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	PutItemFn            func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	DeleteItemFn         func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	BatchWriteItemFn     func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItemsFn func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+	QueryFn              func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	ScanFn               func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
 }
 
-func (m *mockedDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+func (m *mockedDynamoDB) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
 	return m.GetItemFn(input)
 }
 
-func (m *mockedDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+func (m *mockedDynamoDB) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
 	return m.PutItemFn(input)
 }
 
-func (m *mockedDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+func (m *mockedDynamoDB) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
 	return m.DeleteItemFn(input)
 }
 
-func (m *mockedDynamoDB) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+func (m *mockedDynamoDB) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
 	return m.BatchWriteItemFn(input)
 }
 
+func (m *mockedDynamoDB) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	return m.TransactWriteItemsFn(input)
+}
+
+func (m *mockedDynamoDB) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	return m.QueryFn(input)
+}
+
+func (m *mockedDynamoDB) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	return m.ScanFn(input)
+}
+
 func TestInit(t *testing.T) {
 	m := state.Metadata{}
 	s := NewDynamoDBStateStore()
@@ -63,6 +81,40 @@ func TestInit(t *testing.T) {
 	})
 }
 
+func TestGetClient(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	assert.Nil(t, err)
+
+	t.Run("useDAX unset returns a plain DynamoDB client", func(t *testing.T) {
+		ss := &StateStore{}
+		client := ss.getClient(sess, state.Metadata{Properties: map[string]string{}})
+		_, ok := client.(*dynamodb.DynamoDB)
+		assert.True(t, ok)
+	})
+}
+
+func TestDaxReachable(t *testing.T) {
+	ss := &StateStore{table: "table_name"}
+
+	t.Run("Reachable when the probe succeeds", func(t *testing.T) {
+		client := &mockedDynamoDB{
+			GetItemFn: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{}, nil
+			},
+		}
+		assert.True(t, ss.daxReachable(client))
+	})
+
+	t.Run("Unreachable when the probe errors", func(t *testing.T) {
+		client := &mockedDynamoDB{
+			GetItemFn: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return nil, fmt.Errorf("connection refused")
+			},
+		}
+		assert.False(t, ss.daxReachable(client))
+	})
+}
+
 func TestGet(t *testing.T) {
 	t.Run("Successfully retrieve item", func(t *testing.T) {
 		ss := StateStore{
@@ -88,7 +140,7 @@ func TestGet(t *testing.T) {
 				Consistency: "strong",
 			},
 		}
-		out, err := ss.Get(req)
+		out, err := ss.Get(context.Background(), req)
 		assert.Nil(t, err)
 		assert.Equal(t, []byte("value"), out.Data)
 	})
@@ -107,7 +159,7 @@ func TestGet(t *testing.T) {
 				Consistency: "strong",
 			},
 		}
-		out, err := ss.Get(req)
+		out, err := ss.Get(context.Background(), req)
 		assert.NotNil(t, err)
 		assert.Nil(t, out)
 	})
@@ -128,7 +180,39 @@ func TestGet(t *testing.T) {
 				Consistency: "strong",
 			},
 		}
-		out, err := ss.Get(req)
+		out, err := ss.Get(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Nil(t, out.Data)
+	})
+	t.Run("Unsuccessfully with expired ttl", func(t *testing.T) {
+		ss := StateStore{
+			ttlAttributeName: defaultTTLAttributeName,
+			client: &mockedDynamoDB{
+				GetItemFn: func(input *dynamodb.GetItemInput) (output *dynamodb.GetItemOutput, err error) {
+					return &dynamodb.GetItemOutput{
+						Item: map[string]*dynamodb.AttributeValue{
+							"key": {
+								S: aws.String("key"),
+							},
+							"value": {
+								S: aws.String("value"),
+							},
+							"expiresAt": {
+								N: aws.String(fmt.Sprintf("%d", time.Now().Unix()-100)),
+							},
+						},
+					}, nil
+				},
+			},
+		}
+		req := &state.GetRequest{
+			Key:      "key",
+			Metadata: nil,
+			Options: state.GetStateOption{
+				Consistency: "strong",
+			},
+		}
+		out, err := ss.Get(context.Background(), req)
 		assert.Nil(t, err)
 		assert.Nil(t, out.Data)
 	})
@@ -153,7 +237,7 @@ func TestGet(t *testing.T) {
 				Consistency: "strong",
 			},
 		}
-		out, err := ss.Get(req)
+		out, err := ss.Get(context.Background(), req)
 		assert.Nil(t, err)
 		assert.Empty(t, out.Data)
 	})
@@ -164,6 +248,8 @@ func TestSet(t *testing.T) {
 		ss := StateStore{
 			client: &mockedDynamoDB{
 				PutItemFn: func(input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, err error) {
+					assert.Contains(t, input.Item, "etag")
+					delete(input.Item, "etag")
 					assert.Equal(t, map[string]*dynamodb.AttributeValue{
 						"key": {
 							S: aws.String("key"),
@@ -187,7 +273,7 @@ func TestSet(t *testing.T) {
 			Key:   "key",
 			Value: []byte("value"),
 		}
-		err := ss.Set(req)
+		err := ss.Set(context.Background(), req)
 		assert.Nil(t, err)
 	})
 	t.Run("Un-successfully set item", func(t *testing.T) {
@@ -202,8 +288,51 @@ func TestSet(t *testing.T) {
 			Key:   "key",
 			Value: []byte("value"),
 		}
-		err := ss.Set(req)
+		err := ss.Set(context.Background(), req)
+		assert.NotNil(t, err)
+	})
+	t.Run("Successfully set item with ttl", func(t *testing.T) {
+		ss := StateStore{
+			ttlAttributeName: defaultTTLAttributeName,
+			enableTTL:        true,
+			client: &mockedDynamoDB{
+				PutItemFn: func(input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, err error) {
+					assert.Contains(t, input.Item, "expiresAt")
+					assert.NotNil(t, input.Item["expiresAt"].N)
+
+					return &dynamodb.PutItemOutput{}, nil
+				},
+			},
+		}
+		req := &state.SetRequest{
+			Key:      "key",
+			Value:    []byte("value"),
+			Metadata: map[string]string{"ttlInSeconds": "180"},
+		}
+		err := ss.Set(context.Background(), req)
+		assert.Nil(t, err)
+	})
+	t.Run("Unsuccessfully set item with mismatched etag", func(t *testing.T) {
+		ss := StateStore{
+			client: &mockedDynamoDB{
+				PutItemFn: func(input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, err error) {
+					assert.Equal(t, etagConditionExpression, *input.ConditionExpression)
+					assert.Equal(t, "bad-etag", *input.ExpressionAttributeValues[":etag"].S)
+
+					return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+				},
+			},
+		}
+		req := &state.SetRequest{
+			Key:   "key",
+			Value: []byte("value"),
+			ETag:  "bad-etag",
+		}
+		err := ss.Set(context.Background(), req)
 		assert.NotNil(t, err)
+		etagErr, ok := err.(*state.ETagError)
+		assert.True(t, ok)
+		assert.Equal(t, state.ETagMismatch, etagErr.Kind())
 	})
 }
 
@@ -213,6 +342,11 @@ func TestBulkSet(t *testing.T) {
 		ss := StateStore{
 			client: &mockedDynamoDB{
 				BatchWriteItemFn: func(input *dynamodb.BatchWriteItemInput) (output *dynamodb.BatchWriteItemOutput, err error) {
+					for _, wr := range input.RequestItems[tableName] {
+						assert.Contains(t, wr.PutRequest.Item, "etag")
+						delete(wr.PutRequest.Item, "etag")
+					}
+
 					expected := map[string][]*dynamodb.WriteRequest{}
 					expected[tableName] = []*dynamodb.WriteRequest{
 						{
@@ -259,7 +393,7 @@ func TestBulkSet(t *testing.T) {
 				Value: []byte("value2"),
 			},
 		}
-		err := ss.BulkSet(req)
+		err := ss.BulkSet(context.Background(), req)
 		assert.Nil(t, err)
 	})
 	t.Run("Un-successfully set items", func(t *testing.T) {
@@ -276,7 +410,88 @@ func TestBulkSet(t *testing.T) {
 				Value: []byte("value"),
 			},
 		}
-		err := ss.BulkSet(req)
+		err := ss.BulkSet(context.Background(), req)
+		assert.NotNil(t, err)
+	})
+	t.Run("Successfully set items with ttl", func(t *testing.T) {
+		tableName := "table_name"
+		ss := StateStore{
+			ttlAttributeName: defaultTTLAttributeName,
+			enableTTL:        true,
+			client: &mockedDynamoDB{
+				BatchWriteItemFn: func(input *dynamodb.BatchWriteItemInput) (output *dynamodb.BatchWriteItemOutput, err error) {
+					for _, wr := range input.RequestItems[tableName] {
+						assert.Contains(t, wr.PutRequest.Item, "expiresAt")
+						assert.NotNil(t, wr.PutRequest.Item["expiresAt"].N)
+					}
+
+					return &dynamodb.BatchWriteItemOutput{
+						UnprocessedItems: map[string][]*dynamodb.WriteRequest{},
+					}, nil
+				},
+			},
+			table: tableName,
+		}
+		req := []state.SetRequest{
+			{
+				Key:      "key1",
+				Value:    []byte("value1"),
+				Metadata: map[string]string{"ttlInSeconds": "180"},
+			},
+			{
+				Key:      "key2",
+				Value:    []byte("value2"),
+				Metadata: map[string]string{"ttlInSeconds": "180"},
+			},
+		}
+		err := ss.BulkSet(context.Background(), req)
+		assert.Nil(t, err)
+	})
+	t.Run("Successfully set items with etag via transaction", func(t *testing.T) {
+		tableName := "table_name"
+		ss := StateStore{
+			client: &mockedDynamoDB{
+				TransactWriteItemsFn: func(input *dynamodb.TransactWriteItemsInput) (output *dynamodb.TransactWriteItemsOutput, err error) {
+					assert.Len(t, input.TransactItems, 2)
+					assert.Equal(t, tableName, *input.TransactItems[0].Put.TableName)
+					assert.Equal(t, etagConditionExpression, *input.TransactItems[0].Put.ConditionExpression)
+					assert.Nil(t, input.TransactItems[1].Put.ConditionExpression)
+
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				},
+			},
+			table: tableName,
+		}
+		req := []state.SetRequest{
+			{
+				Key:   "key1",
+				Value: []byte("value1"),
+				ETag:  "etag1",
+			},
+			{
+				Key:   "key2",
+				Value: []byte("value2"),
+			},
+		}
+		err := ss.BulkSet(context.Background(), req)
+		assert.Nil(t, err)
+	})
+	t.Run("Unsuccessfully set items with etag via transaction", func(t *testing.T) {
+		ss := StateStore{
+			client: &mockedDynamoDB{
+				TransactWriteItemsFn: func(input *dynamodb.TransactWriteItemsInput) (output *dynamodb.TransactWriteItemsOutput, err error) {
+					return nil, awserr.New(dynamodb.ErrCodeTransactionCanceledException, "ConditionalCheckFailed", nil)
+				},
+			},
+		}
+		req := []state.SetRequest{
+			{
+				Key:   "key1",
+				Value: []byte("value1"),
+				ETag:  "bad-etag",
+			},
+		}
+		err := ss.BulkSet(context.Background(), req)
 		assert.NotNil(t, err)
 	})
 }
@@ -300,7 +515,7 @@ func TestDelete(t *testing.T) {
 				},
 			},
 		}
-		err := ss.Delete(req)
+		err := ss.Delete(context.Background(), req)
 		assert.Nil(t, err)
 	})
 
@@ -315,9 +530,30 @@ func TestDelete(t *testing.T) {
 		req := &state.DeleteRequest{
 			Key: "key",
 		}
-		err := ss.Delete(req)
+		err := ss.Delete(context.Background(), req)
 		assert.NotNil(t, err)
 	})
+
+	t.Run("Unsuccessfully delete item with mismatched etag", func(t *testing.T) {
+		ss := StateStore{
+			client: &mockedDynamoDB{
+				DeleteItemFn: func(input *dynamodb.DeleteItemInput) (output *dynamodb.DeleteItemOutput, err error) {
+					assert.Equal(t, etagConditionExpression, *input.ConditionExpression)
+
+					return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+				},
+			},
+		}
+		req := &state.DeleteRequest{
+			Key:  "key",
+			ETag: "bad-etag",
+		}
+		err := ss.Delete(context.Background(), req)
+		assert.NotNil(t, err)
+		etagErr, ok := err.(*state.ETagError)
+		assert.True(t, ok)
+		assert.Equal(t, state.ETagMismatch, etagErr.Kind())
+	})
 }
 
 func TestBulkDelete(t *testing.T) {
@@ -364,7 +600,7 @@ func TestBulkDelete(t *testing.T) {
 				Key: "key2",
 			},
 		}
-		err := ss.BulkDelete(req)
+		err := ss.BulkDelete(context.Background(), req)
 		assert.Nil(t, err)
 	})
 	t.Run("Un-successfully delete items", func(t *testing.T) {
@@ -380,7 +616,140 @@ func TestBulkDelete(t *testing.T) {
 				Key: "key",
 			},
 		}
-		err := ss.BulkDelete(req)
+		err := ss.BulkDelete(context.Background(), req)
 		assert.NotNil(t, err)
 	})
+	t.Run("Unsuccessfully delete items with mismatched etag via transaction", func(t *testing.T) {
+		ss := StateStore{
+			client: &mockedDynamoDB{
+				TransactWriteItemsFn: func(input *dynamodb.TransactWriteItemsInput) (output *dynamodb.TransactWriteItemsOutput, err error) {
+					assert.Len(t, input.TransactItems, 1)
+					assert.Equal(t, etagConditionExpression, *input.TransactItems[0].Delete.ConditionExpression)
+					assert.Equal(t, "bad-etag", *input.TransactItems[0].Delete.ExpressionAttributeValues[":etag"].S)
+
+					return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+				},
+			},
+		}
+		req := []state.DeleteRequest{
+			{
+				Key:  "key",
+				ETag: "bad-etag",
+			},
+		}
+		err := ss.BulkDelete(context.Background(), req)
+		assert.NotNil(t, err)
+		etagErr, ok := err.(*state.ETagError)
+		assert.True(t, ok)
+		assert.Equal(t, state.ETagMismatch, etagErr.Kind())
+	})
+}
+
+func TestMulti(t *testing.T) {
+	tableName := "table_name"
+
+	t.Run("Successfully execute a mixed transaction", func(t *testing.T) {
+		ss := StateStore{
+			client: &mockedDynamoDB{
+				TransactWriteItemsFn: func(input *dynamodb.TransactWriteItemsInput) (output *dynamodb.TransactWriteItemsOutput, err error) {
+					assert.Len(t, input.TransactItems, 2)
+					assert.NotNil(t, input.TransactItems[0].Put)
+					assert.Equal(t, tableName, *input.TransactItems[0].Put.TableName)
+					assert.NotNil(t, input.TransactItems[1].Delete)
+					assert.Equal(t, tableName, *input.TransactItems[1].Delete.TableName)
+
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				},
+			},
+			table: tableName,
+		}
+		ops := []state.TransactionalOperation{
+			{
+				Operation: state.Upsert,
+				Request: state.SetRequest{
+					Key:   "key1",
+					Value: []byte("value1"),
+				},
+			},
+			{
+				Operation: state.Delete,
+				Request: state.DeleteRequest{
+					Key: "key2",
+				},
+			},
+		}
+		err := ss.Multi(context.Background(), ops)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Unsuccessfully execute a transaction with partial failure", func(t *testing.T) {
+		ss := StateStore{
+			client: &mockedDynamoDB{
+				TransactWriteItemsFn: func(input *dynamodb.TransactWriteItemsInput) (output *dynamodb.TransactWriteItemsOutput, err error) {
+					return nil, &dynamodb.TransactionCanceledException{
+						CancellationReasons: []*dynamodb.CancellationReason{
+							{
+								Code: aws.String("None"),
+							},
+							{
+								Code:    aws.String("ConditionalCheckFailed"),
+								Message: aws.String("the conditional request failed"),
+							},
+						},
+					}
+				},
+			},
+			table: tableName,
+		}
+		ops := []state.TransactionalOperation{
+			{
+				Operation: state.Upsert,
+				Request: state.SetRequest{
+					Key:   "key1",
+					Value: []byte("value1"),
+				},
+			},
+			{
+				Operation: state.Delete,
+				Request: state.DeleteRequest{
+					Key: "key2",
+				},
+			},
+		}
+		err := ss.Multi(context.Background(), ops)
+		assert.NotNil(t, err)
+
+		cancelErr, ok := err.(*TransactionCancelledError)
+		assert.True(t, ok)
+		assert.Len(t, cancelErr.Reasons, 1)
+		assert.Equal(t, "key2", cancelErr.Reasons[0].Key)
+		assert.Equal(t, "ConditionalCheckFailed", cancelErr.Reasons[0].Code)
+	})
+}
+
+func TestReadWriteCapacity(t *testing.T) {
+	t.Run("Both units set selects provisioned billing", func(t *testing.T) {
+		m := state.Metadata{Properties: map[string]string{
+			"readCapacityUnits":  "5",
+			"writeCapacityUnits": "10",
+		}}
+		rcu, wcu, ok := readWriteCapacity(m)
+		assert.True(t, ok)
+		assert.Equal(t, int64(5), rcu)
+		assert.Equal(t, int64(10), wcu)
+	})
+
+	t.Run("Missing units falls back to on-demand", func(t *testing.T) {
+		_, _, ok := readWriteCapacity(state.Metadata{Properties: map[string]string{}})
+		assert.False(t, ok)
+	})
+
+	t.Run("Non-numeric units falls back to on-demand", func(t *testing.T) {
+		m := state.Metadata{Properties: map[string]string{
+			"readCapacityUnits":  "many",
+			"writeCapacityUnits": "10",
+		}}
+		_, _, ok := readWriteCapacity(m)
+		assert.False(t, ok)
+	})
 }
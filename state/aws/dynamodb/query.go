@@ -0,0 +1,443 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/dapr/components-contrib/state"
+)
+
+// queryIndex describes a GSI operators can declare in component metadata so
+// the query planner can route a filter to an index instead of scanning.
+type queryIndex struct {
+	Name         string `json:"name"`
+	PartitionKey string `json:"partitionKey"`
+	SortKey      string `json:"sortKey,omitempty"`
+}
+
+// parseQueryIndexes decodes the `queryIndexes` metadata property, a JSON
+// array of queryIndex entries. An empty/absent value means no GSIs are
+// available and every query falls back to a Scan.
+func parseQueryIndexes(raw string) ([]queryIndex, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var indexes []queryIndex
+	if err := json.Unmarshal([]byte(raw), &indexes); err != nil {
+		return nil, fmt.Errorf("dynamodb error: failed to parse queryIndexes metadata: %s", err)
+	}
+
+	return indexes, nil
+}
+
+// Query implements state.Queryable. It plans the request's filter against
+// the table's primary key and any declared GSIs, preferring a DynamoDB Query
+// when the filter pins down a partition key and falling back to a paginated
+// Scan otherwise.
+func (d *StateStore) Query(ctx context.Context, req *state.QueryRequest) (*state.QueryResponse, error) {
+	plan, err := d.planQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusiveStartKey, err := decodePageToken(req.Query.Page.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]*dynamodb.AttributeValue
+	var lastEvaluatedKey map[string]*dynamodb.AttributeValue
+
+	if plan.keyConditionExpression != "" {
+		input := &dynamodb.QueryInput{
+			TableName:                 aws.String(d.table),
+			IndexName:                 plan.indexName,
+			KeyConditionExpression:    aws.String(plan.keyConditionExpression),
+			ExpressionAttributeNames:  plan.expressionNames,
+			ExpressionAttributeValues: plan.expressionValues,
+			ExclusiveStartKey:         exclusiveStartKey,
+		}
+		if plan.filterExpression != "" {
+			input.FilterExpression = aws.String(plan.filterExpression)
+		}
+		if req.Query.Page.Limit > 0 {
+			input.Limit = aws.Int64(int64(req.Query.Page.Limit))
+		}
+
+		out, err := d.client.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		items, lastEvaluatedKey = out.Items, out.LastEvaluatedKey
+	} else {
+		input := &dynamodb.ScanInput{
+			TableName:                 aws.String(d.table),
+			ExpressionAttributeNames:  plan.expressionNames,
+			ExpressionAttributeValues: plan.expressionValues,
+			ExclusiveStartKey:         exclusiveStartKey,
+		}
+		if plan.filterExpression != "" {
+			input.FilterExpression = aws.String(plan.filterExpression)
+		}
+		if req.Query.Page.Limit > 0 {
+			input.Limit = aws.Int64(int64(req.Query.Page.Limit))
+		}
+
+		out, err := d.client.ScanWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		items, lastEvaluatedKey = out.Items, out.LastEvaluatedKey
+	}
+
+	token, err := encodePageToken(lastEvaluatedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]state.QueryItem, 0, len(items))
+	for _, item := range items {
+		if d.isExpired(item) {
+			continue
+		}
+
+		result := state.QueryItem{}
+		if attr, ok := item["key"]; ok && attr.S != nil {
+			result.Key = *attr.S
+		}
+		if attr, ok := item["value"]; ok && attr.S != nil {
+			result.Data = []byte(*attr.S)
+		}
+		if attr, ok := item[etagAttributeName]; ok && attr.S != nil {
+			result.ETag = *attr.S
+		}
+
+		results = append(results, result)
+	}
+
+	return &state.QueryResponse{
+		Results: results,
+		Token:   token,
+	}, nil
+}
+
+// queryPlan is the result of translating a state.Query into a DynamoDB
+// operation: either a Query against the table or a declared GSI, or - when
+// no partition key is pinned down - a Scan.
+type queryPlan struct {
+	indexName              *string
+	keyConditionExpression string
+	filterExpression       string
+	expressionNames        map[string]*string
+	expressionValues       map[string]*dynamodb.AttributeValue
+}
+
+// planQuery picks a DynamoDB access pattern for the given filter: a Query
+// against the table's partition key, a Query against a declared GSI, or (if
+// neither key is pinned down by an equality predicate) a Scan. Whichever key
+// is chosen becomes the KeyConditionExpression; when a GSI match also
+// declares a SortKey, a predicate on that field is folded into the same
+// KeyConditionExpression too, where the predicate maps cleanly to a single
+// DynamoDB key condition (string equality, a single bound, or a gte+lte range).
+// Every other predicate is rendered into the FilterExpression instead.
+func (d *StateStore) planQuery(query state.Query) (*queryPlan, error) {
+	plan := &queryPlan{
+		expressionNames:  map[string]*string{},
+		expressionValues: map[string]*dynamodb.AttributeValue{},
+	}
+
+	remaining := make(map[string]interface{}, len(query.Filters))
+	for field, predicate := range query.Filters {
+		remaining[field] = predicate
+	}
+
+	if predicate, ok := remaining["key"]; ok {
+		value, isEquality := predicate.(string)
+		if isEquality {
+			plan.keyConditionExpression = "#key = :key"
+			plan.expressionNames["#key"] = aws.String("key")
+			plan.expressionValues[":key"] = &dynamodb.AttributeValue{S: aws.String(value)}
+			delete(remaining, "key")
+		}
+	}
+
+	if plan.keyConditionExpression == "" {
+		for _, idx := range d.indexes {
+			predicate, ok := remaining[idx.PartitionKey]
+			if !ok {
+				continue
+			}
+			value, isEquality := predicate.(string)
+			if !isEquality {
+				continue
+			}
+
+			plan.indexName = aws.String(idx.Name)
+			plan.keyConditionExpression = "#pk = :pk"
+			plan.expressionNames["#pk"] = aws.String(idx.PartitionKey)
+			plan.expressionValues[":pk"] = &dynamodb.AttributeValue{S: aws.String(value)}
+			delete(remaining, idx.PartitionKey)
+
+			if idx.SortKey != "" {
+				if sortPredicate, ok := remaining[idx.SortKey]; ok {
+					if clause, ok := renderSortKeyCondition(idx.SortKey, sortPredicate, plan.expressionNames, plan.expressionValues); ok {
+						plan.keyConditionExpression += " AND " + clause
+						delete(remaining, idx.SortKey)
+					}
+				}
+			}
+
+			break
+		}
+	}
+
+	filterExpr, err := renderFilterExpression(remaining, plan.expressionNames, plan.expressionValues)
+	if err != nil {
+		return nil, err
+	}
+	plan.filterExpression = filterExpr
+
+	if len(plan.expressionNames) == 0 {
+		plan.expressionNames = nil
+	}
+	if len(plan.expressionValues) == 0 {
+		plan.expressionValues = nil
+	}
+
+	return plan, nil
+}
+
+// renderSortKeyCondition renders a predicate on a declared GSI's sort key
+// into a single DynamoDB KeyConditionExpression clause, e.g. "#sk = :sk" for
+// an equality match or "#sk BETWEEN :sk_gte AND :sk_lte" for a bounded
+// range. DynamoDB's key condition grammar allows only one clause per
+// attribute, so only a bare string (equality), a single bound (">", ">=",
+// "<", "<=") or a "gte"+"lte" pair (BETWEEN) can be expressed this way; any
+// other combination returns false so the predicate is left in place for the
+// caller to fall back to a FilterExpression instead.
+func renderSortKeyCondition(field string, predicate interface{}, names map[string]*string, values map[string]*dynamodb.AttributeValue) (string, bool) {
+	const name = "#sk"
+
+	switch p := predicate.(type) {
+	case string:
+		names[name] = aws.String(field)
+		values[":sk"] = &dynamodb.AttributeValue{S: aws.String(p)}
+		return fmt.Sprintf("%s = :sk", name), true
+	case map[string]interface{}:
+		_, hasGt := p["gt"]
+		_, hasLt := p["lt"]
+		gte, hasGte := p["gte"]
+		lte, hasLte := p["lte"]
+
+		switch {
+		case hasGte && hasLte && !hasGt && !hasLt && len(p) == 2:
+			loAttr, err := toAttributeValue(gte)
+			if err != nil {
+				return "", false
+			}
+			hiAttr, err := toAttributeValue(lte)
+			if err != nil {
+				return "", false
+			}
+			names[name] = aws.String(field)
+			values[":sk_gte"] = loAttr
+			values[":sk_lte"] = hiAttr
+			return fmt.Sprintf("%s BETWEEN :sk_gte AND :sk_lte", name), true
+		case len(p) == 1:
+			for op, v := range p {
+				symbol, ok := map[string]string{"gte": ">=", "gt": ">", "lte": "<=", "lt": "<"}[op]
+				if !ok {
+					return "", false
+				}
+				attr, err := toAttributeValue(v)
+				if err != nil {
+					return "", false
+				}
+				names[name] = aws.String(field)
+				valueName := fmt.Sprintf(":sk_%s", op)
+				values[valueName] = attr
+				return fmt.Sprintf("%s %s %s", name, symbol, valueName), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// renderFilterExpression turns the remaining (non-key) predicates into a
+// DynamoDB FilterExpression, supporting equality, IN and range predicates.
+// Equality and IN take a bare value or a []interface{}; ranges take a
+// map with any of "gte"/"gt"/"lte"/"lt". Fields are processed in sorted
+// order so the generated expression is deterministic despite `filters`
+// being a map.
+func renderFilterExpression(filters map[string]interface{}, names map[string]*string, values map[string]*dynamodb.AttributeValue) (string, error) {
+	fields := make([]string, 0, len(filters))
+	for field := range filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	clauses := make([]string, 0, len(filters))
+
+	for i, field := range fields {
+		predicate := filters[field]
+		name := fmt.Sprintf("#f%d", i)
+		names[name] = aws.String(field)
+
+		switch p := predicate.(type) {
+		case []interface{}:
+			placeholders := make([]string, 0, len(p))
+			for j, v := range p {
+				valueName := fmt.Sprintf(":f%d_%d", i, j)
+				attr, err := toAttributeValue(v)
+				if err != nil {
+					return "", err
+				}
+				values[valueName] = attr
+				placeholders = append(placeholders, valueName)
+			}
+			clauses = append(clauses, fmt.Sprintf("%s IN (%s)", name, joinPlaceholders(placeholders)))
+		case map[string]interface{}:
+			clause, err := renderRangeClause(name, p, fmt.Sprintf("f%d", i), values)
+			if err != nil {
+				return "", err
+			}
+			clauses = append(clauses, clause)
+		default:
+			valueName := fmt.Sprintf(":f%d", i)
+			attr, err := toAttributeValue(p)
+			if err != nil {
+				return "", err
+			}
+			values[valueName] = attr
+			clauses = append(clauses, fmt.Sprintf("%s = %s", name, valueName))
+		}
+	}
+
+	return joinClauses(clauses), nil
+}
+
+// renderRangeClause renders a single range predicate, e.g.
+// {"gte": 10, "lte": 20} -> "#f0 >= :f0_gte AND #f0 <= :f0_lte". Operators
+// are processed in sorted order so the generated clause is deterministic
+// despite `bounds` being a map.
+func renderRangeClause(name string, bounds map[string]interface{}, valuePrefix string, values map[string]*dynamodb.AttributeValue) (string, error) {
+	ops := map[string]string{"gte": ">=", "gt": ">", "lte": "<=", "lt": "<"}
+
+	keys := make([]string, 0, len(bounds))
+	for op := range bounds {
+		keys = append(keys, op)
+	}
+	sort.Strings(keys)
+
+	clauses := make([]string, 0, len(bounds))
+	for _, op := range keys {
+		symbol, ok := ops[op]
+		if !ok {
+			return "", fmt.Errorf("dynamodb error: unsupported range operator %q", op)
+		}
+
+		valueName := fmt.Sprintf(":%s_%s", valuePrefix, op)
+		attr, err := toAttributeValue(bounds[op])
+		if err != nil {
+			return "", err
+		}
+		values[valueName] = attr
+
+		clauses = append(clauses, fmt.Sprintf("%s %s %s", name, symbol, valueName))
+	}
+
+	return joinClauses(clauses), nil
+}
+
+func joinClauses(clauses []string) string {
+	if len(clauses) == 0 {
+		return ""
+	}
+
+	out := clauses[0]
+	for _, c := range clauses[1:] {
+		out += " AND " + c
+	}
+
+	return out
+}
+
+func joinPlaceholders(placeholders []string) string {
+	if len(placeholders) == 0 {
+		return ""
+	}
+
+	out := placeholders[0]
+	for _, p := range placeholders[1:] {
+		out += ", " + p
+	}
+
+	return out
+}
+
+// toAttributeValue converts a decoded JSON filter value into the DynamoDB
+// attribute it's compared against. Strings map to S, numbers (which arrive
+// as float64 via encoding/json) to N and booleans to BOOL; any other type is
+// rejected with an error.
+func toAttributeValue(v interface{}) (*dynamodb.AttributeValue, error) {
+	switch value := v.(type) {
+	case string:
+		return &dynamodb.AttributeValue{S: aws.String(value)}, nil
+	case float64:
+		return &dynamodb.AttributeValue{N: aws.String(fmt.Sprintf("%v", value))}, nil
+	case bool:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(value)}, nil
+	default:
+		return nil, fmt.Errorf("dynamodb error: unsupported filter value type %T", v)
+	}
+}
+
+// encodePageToken round-trips a LastEvaluatedKey as an opaque base64 token
+// so callers don't need to know anything about DynamoDB's key shape.
+func encodePageToken(key map[string]*dynamodb.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// decodePageToken reverses encodePageToken, returning a nil
+// ExclusiveStartKey when the token is empty (first page).
+func decodePageToken(token string) (map[string]*dynamodb.AttributeValue, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("dynamodb error: invalid page token: %s", err)
+	}
+
+	var key map[string]*dynamodb.AttributeValue
+	if err := json.Unmarshal(b, &key); err != nil {
+		return nil, fmt.Errorf("dynamodb error: invalid page token: %s", err)
+	}
+
+	return key, nil
+}
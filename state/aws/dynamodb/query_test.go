@@ -0,0 +1,293 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/dapr/components-contrib/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// mustFloat parses a numeric DynamoDB AttributeValue back into a float64 for
+// comparison in tests.
+func mustFloat(t *testing.T, attr *dynamodb.AttributeValue) float64 {
+	t.Helper()
+
+	f, err := strconv.ParseFloat(*attr.N, 64)
+	assert.Nil(t, err)
+
+	return f
+}
+
+func TestQuery(t *testing.T) {
+	t.Run("Equality on the partition key uses Query, not Scan", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			client: &mockedDynamoDB{
+				QueryFn: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+					assert.Nil(t, input.IndexName)
+					assert.Equal(t, "#key = :key", *input.KeyConditionExpression)
+					assert.Equal(t, "key1", *input.ExpressionAttributeValues[":key"].S)
+
+					return &dynamodb.QueryOutput{
+						Items: []map[string]*dynamodb.AttributeValue{
+							{
+								"key":   {S: aws.String("key1")},
+								"value": {S: aws.String("value1")},
+							},
+						},
+					}, nil
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{"key": "key1"},
+			},
+		}
+		resp, err := ss.Query(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Len(t, resp.Results, 1)
+		assert.Equal(t, "key1", resp.Results[0].Key)
+		assert.Equal(t, []byte("value1"), resp.Results[0].Data)
+	})
+
+	t.Run("Equality on a declared GSI partition key uses the index", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			indexes: []queryIndex{
+				{Name: "gsi1", PartitionKey: "status"},
+			},
+			client: &mockedDynamoDB{
+				QueryFn: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+					assert.Equal(t, "gsi1", *input.IndexName)
+					assert.Equal(t, "#pk = :pk", *input.KeyConditionExpression)
+					assert.Equal(t, "status", *input.ExpressionAttributeNames["#pk"])
+					assert.Equal(t, "done", *input.ExpressionAttributeValues[":pk"].S)
+
+					return &dynamodb.QueryOutput{}, nil
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{"status": "done"},
+			},
+		}
+		resp, err := ss.Query(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Empty(t, resp.Results)
+	})
+
+	t.Run("Equality on a declared GSI sort key joins the key condition", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			indexes: []queryIndex{
+				{Name: "gsi1", PartitionKey: "status", SortKey: "updatedAt"},
+			},
+			client: &mockedDynamoDB{
+				QueryFn: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+					assert.Equal(t, "gsi1", *input.IndexName)
+					assert.Equal(t, "#pk = :pk AND #sk = :sk", *input.KeyConditionExpression)
+					assert.Equal(t, "status", *input.ExpressionAttributeNames["#pk"])
+					assert.Equal(t, "updatedAt", *input.ExpressionAttributeNames["#sk"])
+					assert.Equal(t, "done", *input.ExpressionAttributeValues[":pk"].S)
+					assert.Equal(t, "2020-01-01", *input.ExpressionAttributeValues[":sk"].S)
+
+					return &dynamodb.QueryOutput{}, nil
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{
+					"status":    "done",
+					"updatedAt": "2020-01-01",
+				},
+			},
+		}
+		resp, err := ss.Query(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Empty(t, resp.Results)
+	})
+
+	t.Run("A range on a declared GSI sort key joins the key condition as BETWEEN", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			indexes: []queryIndex{
+				{Name: "gsi1", PartitionKey: "status", SortKey: "score"},
+			},
+			client: &mockedDynamoDB{
+				QueryFn: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+					assert.Equal(t, "gsi1", *input.IndexName)
+					assert.Equal(t, "#pk = :pk AND #sk BETWEEN :sk_gte AND :sk_lte", *input.KeyConditionExpression)
+					assert.Equal(t, float64(10), mustFloat(t, input.ExpressionAttributeValues[":sk_gte"]))
+					assert.Equal(t, float64(20), mustFloat(t, input.ExpressionAttributeValues[":sk_lte"]))
+					assert.Nil(t, input.FilterExpression)
+
+					return &dynamodb.QueryOutput{}, nil
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{
+					"status": "done",
+					"score":  map[string]interface{}{"gte": float64(10), "lte": float64(20)},
+				},
+			},
+		}
+		_, err := ss.Query(context.Background(), req)
+		assert.Nil(t, err)
+	})
+
+	t.Run("A sort key range that doesn't map to a single key condition falls back to the filter expression", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			indexes: []queryIndex{
+				{Name: "gsi1", PartitionKey: "status", SortKey: "score"},
+			},
+			client: &mockedDynamoDB{
+				QueryFn: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+					assert.Equal(t, "#pk = :pk", *input.KeyConditionExpression)
+					assert.Equal(t, "#f0 > :f0_gt AND #f0 < :f0_lt", *input.FilterExpression)
+					assert.Equal(t, "score", *input.ExpressionAttributeNames["#f0"])
+
+					return &dynamodb.QueryOutput{}, nil
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{
+					"status": "done",
+					"score":  map[string]interface{}{"gt": float64(10), "lt": float64(20)},
+				},
+			},
+		}
+		_, err := ss.Query(context.Background(), req)
+		assert.Nil(t, err)
+	})
+
+	t.Run("No key predicate falls back to Scan with a filter expression", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			client: &mockedDynamoDB{
+				ScanFn: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+					assert.Equal(t, "#f0 = :f0", *input.FilterExpression)
+					assert.Equal(t, "status", *input.ExpressionAttributeNames["#f0"])
+					assert.Equal(t, "done", *input.ExpressionAttributeValues[":f0"].S)
+
+					return &dynamodb.ScanOutput{
+						LastEvaluatedKey: map[string]*dynamodb.AttributeValue{
+							"key": {S: aws.String("key1")},
+						},
+					}, nil
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{"status": "done"},
+			},
+		}
+		resp, err := ss.Query(context.Background(), req)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, resp.Token)
+
+		startKey, err := decodePageToken(resp.Token)
+		assert.Nil(t, err)
+		assert.Equal(t, "key1", *startKey["key"].S)
+	})
+
+	t.Run("IN and range predicates render into the filter expression", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			client: &mockedDynamoDB{
+				ScanFn: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+					// Fields are rendered in sorted order ("score" before
+					// "status"), and range operators within a field are too
+					// ("gte" before "lte"), so the expression is deterministic.
+					assert.Equal(t, "#f0 >= :f0_gte AND #f0 <= :f0_lte AND #f1 IN (:f1_0, :f1_1)", *input.FilterExpression)
+					assert.Equal(t, "score", *input.ExpressionAttributeNames["#f0"])
+					assert.Equal(t, "status", *input.ExpressionAttributeNames["#f1"])
+					assert.Equal(t, float64(10), mustFloat(t, input.ExpressionAttributeValues[":f0_gte"]))
+					assert.Equal(t, float64(20), mustFloat(t, input.ExpressionAttributeValues[":f0_lte"]))
+					assert.Equal(t, "done", *input.ExpressionAttributeValues[":f1_0"].S)
+					assert.Equal(t, "archived", *input.ExpressionAttributeValues[":f1_1"].S)
+
+					return &dynamodb.ScanOutput{}, nil
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{
+					"status": []interface{}{"done", "archived"},
+					"score":  map[string]interface{}{"gte": float64(10), "lte": float64(20)},
+				},
+			},
+		}
+		_, err := ss.Query(context.Background(), req)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Query propagates client errors", func(t *testing.T) {
+		ss := StateStore{
+			table: "table_name",
+			client: &mockedDynamoDB{
+				ScanFn: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+					return nil, assert.AnError
+				},
+			},
+		}
+
+		req := &state.QueryRequest{
+			Query: state.Query{
+				Filters: map[string]interface{}{"status": "done"},
+			},
+		}
+		_, err := ss.Query(context.Background(), req)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPageToken(t *testing.T) {
+	t.Run("Empty key round-trips to an empty token", func(t *testing.T) {
+		token, err := encodePageToken(nil)
+		assert.Nil(t, err)
+		assert.Empty(t, token)
+
+		key, err := decodePageToken(token)
+		assert.Nil(t, err)
+		assert.Nil(t, key)
+	})
+
+	t.Run("A key round-trips through the opaque token", func(t *testing.T) {
+		original := map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String("key1")},
+		}
+		token, err := encodePageToken(original)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, token)
+
+		decoded, err := decodePageToken(token)
+		assert.Nil(t, err)
+		assert.Equal(t, "key1", *decoded["key"].S)
+	})
+}